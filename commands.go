@@ -0,0 +1,491 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	"github.com/gemalto/kmip-go/ttlv"
+)
+
+// newRequestMessage builds a RequestMessage with a single batch item and the
+// protocol version this client currently speaks.
+func newRequestMessage(operation kmip14.Operation, payload interface{}) kmip.RequestMessage {
+	return kmip.RequestMessage{
+		RequestHeader: kmip.RequestHeader{
+			ProtocolVersion: kmip.ProtocolVersion{
+				ProtocolVersionMajor: defaultProtocolVersionMajor,
+				ProtocolVersionMinor: defaultProtocolVersionMinor,
+			},
+			BatchCount: 1,
+		},
+		BatchItem: []kmip.RequestBatchItem{
+			{
+				Operation:      operation,
+				RequestPayload: payload,
+			},
+		},
+	}
+}
+
+// newBatchRequestMessage wraps several operations into a single
+// RequestMessage, used by the REPL's "batch send" to submit them as one
+// multi-item KMIP request instead of one round trip per operation.
+func newBatchRequestMessage(ops []kmip.RequestBatchItem) kmip.RequestMessage {
+	return kmip.RequestMessage{
+		RequestHeader: kmip.RequestHeader{
+			ProtocolVersion: kmip.ProtocolVersion{
+				ProtocolVersionMajor: defaultProtocolVersionMajor,
+				ProtocolVersionMinor: defaultProtocolVersionMinor,
+			},
+			BatchCount: len(ops),
+		},
+		BatchItem: ops,
+	}
+}
+
+// doOperation marshals req, sends it through sess, and decodes the single
+// response payload into respPayload.
+func doOperation(sess *Session, req kmip.RequestMessage, respPayload interface{}) (*kmip.ResponseBatchItem, error) {
+	req.RequestHeader.ProtocolVersion = kmip.ProtocolVersion{
+		ProtocolVersionMajor: sess.version.major,
+		ProtocolVersionMinor: sess.version.minor,
+	}
+
+	reqTTLV, err := ttlv.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	respTTLV, _, err := sess.Send(reqTTLV)
+	if err != nil {
+		return nil, err
+	}
+
+	var respMsg kmip.ResponseMessage
+	if err := ttlv.Unmarshal(respTTLV, &respMsg); err != nil {
+		return nil, fmt.Errorf("failed to decode response message: %w", err)
+	}
+
+	if len(respMsg.BatchItem) == 0 {
+		return nil, fmt.Errorf("response contained no batch items")
+	}
+
+	item := respMsg.BatchItem[0]
+	if item.ResultStatus != kmip14.ResultStatusSuccess {
+		return &item, fmt.Errorf("operation failed: %s - %s", item.ResultStatus.String(), item.ResultMessage)
+	}
+
+	if respPayload != nil {
+		if err := ttlv.Unmarshal(item.ResponsePayload.(ttlv.TTLV), respPayload); err != nil {
+			return &item, fmt.Errorf("failed to decode response payload: %w", err)
+		}
+	}
+
+	return &item, nil
+}
+
+// oneShotSession dials a fresh connection for a single CLI invocation,
+// resolves the KMIP protocol version to use (from -protocol, or negotiated
+// via Discover Versions), and wraps it in a Session so commands always go
+// through the same send path, whether invoked directly or from the REPL.
+func oneShotSession(g *globalFlags) (*Session, func(), error) {
+	sess, err := g.newSession()
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	version, err := resolveProtocolVersion(sess, *g.protocol)
+	if err != nil {
+		sess.Close()
+		return nil, func() {}, err
+	}
+	sess.SetVersion(version)
+
+	return sess, func() { sess.Close() }, nil
+}
+
+// parseCryptoAlgorithm accepts only symmetric algorithms: createPayload and
+// registerPayload, its only callers, always build a SymmetricKey object, and
+// an asymmetric algorithm there would need CreateKeyPair/RSA key blocks
+// instead, which this client doesn't implement.
+func parseCryptoAlgorithm(alg string) (kmip14.CryptographicAlgorithm, error) {
+	switch alg {
+	case "AES":
+		return kmip14.CryptographicAlgorithmAES, nil
+	case "DES3", "3DES":
+		return kmip14.CryptographicAlgorithmTripleDES, nil
+	default:
+		return kmip14.CryptographicAlgorithm(0), fmt.Errorf("unsupported cryptographic algorithm %q (want AES or DES3; asymmetric algorithms need CreateKeyPair, which this client doesn't implement)", alg)
+	}
+}
+
+// createPayload builds the Create request payload for a symmetric key. It is
+// shared by buildCreateRequest (single-shot CLI use) and the REPL's batching
+// support, which needs the bare payload to pack alongside other operations
+// into one multi-item RequestMessage.
+func createPayload(alg string, length int, name string) (kmip.CreateRequestPayload, error) {
+	cryptoAlg, err := parseCryptoAlgorithm(alg)
+	if err != nil {
+		return kmip.CreateRequestPayload{}, err
+	}
+
+	attrs := []kmip.Attribute{
+		{AttributeName: "Cryptographic Algorithm", AttributeValue: cryptoAlg},
+		{AttributeName: "Cryptographic Length", AttributeValue: length},
+		{AttributeName: "Cryptographic Usage Mask", AttributeValue: kmip14.CryptographicUsageMaskEncrypt | kmip14.CryptographicUsageMaskDecrypt},
+	}
+	if name != "" {
+		attrs = append(attrs, kmip.Attribute{
+			AttributeName: "Name",
+			AttributeValue: kmip.Name{
+				NameValue: name,
+				NameType:  kmip14.NameTypeUninterpretedTextString,
+			},
+		})
+	}
+
+	return kmip.CreateRequestPayload{
+		ObjectType: kmip14.ObjectTypeSymmetricKey,
+		TemplateAttribute: kmip.TemplateAttribute{
+			Attribute: attrs,
+		},
+	}, nil
+}
+
+// buildCreateRequest constructs a Create request message for a symmetric key.
+func buildCreateRequest(alg string, length int, name string) (kmip.RequestMessage, error) {
+	payload, err := createPayload(alg, length, name)
+	if err != nil {
+		return kmip.RequestMessage{}, err
+	}
+	return newRequestMessage(kmip14.OperationCreate, payload), nil
+}
+
+func printCreateResponse(resp kmip.CreateResponsePayload) {
+	fmt.Printf("Unique Identifier: %s\n", resp.UniqueIdentifier)
+	fmt.Printf("Object Type:       %s\n", resp.ObjectType.String())
+}
+
+func runCreate(args []string) {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	alg := fs.String("alg", "AES", "Symmetric cryptographic algorithm (AES or DES3) (optional)")
+	length := fs.Int("len", 256, "Cryptographic length in bits (optional)")
+	name := fs.String("name", "", "Name to assign to the created object (optional)")
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	req, err := buildCreateRequest(*alg, *length, *name)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.CreateResponsePayload
+	if _, err := doOperation(sess, req, &resp); err != nil {
+		log.Fatalf("Create failed: %v", err)
+	}
+	printCreateResponse(resp)
+}
+
+func buildGetRequest(uid string) kmip.RequestMessage {
+	return newRequestMessage(kmip14.OperationGet, kmip.GetRequestPayload{
+		UniqueIdentifier: uid,
+	})
+}
+
+func printGetResponse(resp kmip.GetResponsePayload) {
+	fmt.Printf("Unique Identifier: %s\n", resp.UniqueIdentifier)
+	fmt.Printf("Object Type:       %s\n", resp.ObjectType.String())
+	if resp.ObjectType != kmip14.ObjectTypeSymmetricKey {
+		fmt.Println("Key Material:      (unsupported: this client only prints SymmetricKey material)")
+		return
+	}
+	if sk, ok := resp.SymmetricKey.KeyBlock.KeyValue.KeyMaterial.([]byte); ok {
+		fmt.Printf("Key Material:      %x\n", sk)
+	}
+}
+
+func runGet(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: kmip-cli get <unique-identifier>")
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.GetResponsePayload
+	if _, err := doOperation(sess, buildGetRequest(fs.Arg(0)), &resp); err != nil {
+		log.Fatalf("Get failed: %v", err)
+	}
+	printGetResponse(resp)
+}
+
+func buildActivateRequest(uid string) kmip.RequestMessage {
+	return newRequestMessage(kmip14.OperationActivate, kmip.ActivateRequestPayload{
+		UniqueIdentifier: uid,
+	})
+}
+
+func printActivateResponse(resp kmip.ActivateResponsePayload) {
+	fmt.Printf("Unique Identifier: %s\n", resp.UniqueIdentifier)
+	fmt.Println("State:             Active")
+}
+
+func runActivate(args []string) {
+	fs := flag.NewFlagSet("activate", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: kmip-cli activate <unique-identifier>")
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.ActivateResponsePayload
+	if _, err := doOperation(sess, buildActivateRequest(fs.Arg(0)), &resp); err != nil {
+		log.Fatalf("Activate failed: %v", err)
+	}
+	printActivateResponse(resp)
+}
+
+func buildDestroyRequest(uid string) kmip.RequestMessage {
+	return newRequestMessage(kmip14.OperationDestroy, kmip.DestroyRequestPayload{
+		UniqueIdentifier: uid,
+	})
+}
+
+func printDestroyResponse(resp kmip.DestroyResponsePayload) {
+	fmt.Printf("Unique Identifier: %s\n", resp.UniqueIdentifier)
+	fmt.Println("Destroyed.")
+}
+
+func runDestroy(args []string) {
+	fs := flag.NewFlagSet("destroy", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: kmip-cli destroy <unique-identifier>")
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.DestroyResponsePayload
+	if _, err := doOperation(sess, buildDestroyRequest(fs.Arg(0)), &resp); err != nil {
+		log.Fatalf("Destroy failed: %v", err)
+	}
+	printDestroyResponse(resp)
+}
+
+func registerPayload(keyMaterial []byte, alg string, length int, name string) (kmip.RegisterRequestPayload, error) {
+	cryptoAlg, err := parseCryptoAlgorithm(alg)
+	if err != nil {
+		return kmip.RegisterRequestPayload{}, err
+	}
+
+	attrs := []kmip.Attribute{
+		{AttributeName: "Cryptographic Algorithm", AttributeValue: cryptoAlg},
+		{AttributeName: "Cryptographic Length", AttributeValue: length},
+		{AttributeName: "Cryptographic Usage Mask", AttributeValue: kmip14.CryptographicUsageMaskEncrypt | kmip14.CryptographicUsageMaskDecrypt},
+	}
+	if name != "" {
+		attrs = append(attrs, kmip.Attribute{
+			AttributeName: "Name",
+			AttributeValue: kmip.Name{
+				NameValue: name,
+				NameType:  kmip14.NameTypeUninterpretedTextString,
+			},
+		})
+	}
+
+	return kmip.RegisterRequestPayload{
+		ObjectType: kmip14.ObjectTypeSymmetricKey,
+		TemplateAttribute: kmip.TemplateAttribute{
+			Attribute: attrs,
+		},
+		SymmetricKey: kmip.SymmetricKey{
+			KeyBlock: kmip.KeyBlock{
+				KeyFormatType: kmip14.KeyFormatTypeRaw,
+				KeyValue: kmip.KeyValue{
+					KeyMaterial: keyMaterial,
+				},
+				CryptographicAlgorithm: cryptoAlg,
+				CryptographicLength:    length,
+			},
+		},
+	}, nil
+}
+
+func buildRegisterRequest(keyMaterial []byte, alg string, length int, name string) (kmip.RequestMessage, error) {
+	payload, err := registerPayload(keyMaterial, alg, length, name)
+	if err != nil {
+		return kmip.RequestMessage{}, err
+	}
+	return newRequestMessage(kmip14.OperationRegister, payload), nil
+}
+
+func printRegisterResponse(resp kmip.RegisterResponsePayload) {
+	fmt.Printf("Unique Identifier: %s\n", resp.UniqueIdentifier)
+}
+
+func runRegister(args []string) {
+	fs := flag.NewFlagSet("register", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	keyMaterialFile := fs.String("key-file", "", "File containing the raw key material to import (required)")
+	alg := fs.String("alg", "AES", "Symmetric cryptographic algorithm of the imported key (AES or DES3) (optional)")
+	length := fs.Int("len", 256, "Cryptographic length in bits of the imported key (optional)")
+	name := fs.String("name", "", "Name to assign to the registered object (optional)")
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *keyMaterialFile == "" {
+		log.Fatalf("-key-file is required")
+	}
+
+	keyMaterial, err := os.ReadFile(*keyMaterialFile)
+	if err != nil {
+		log.Fatalf("Failed to read key material file %q: %v", *keyMaterialFile, err)
+	}
+
+	req, err := buildRegisterRequest(keyMaterial, *alg, *length, *name)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.RegisterResponsePayload
+	if _, err := doOperation(sess, req, &resp); err != nil {
+		log.Fatalf("Register failed: %v", err)
+	}
+	printRegisterResponse(resp)
+}
+
+func buildLocateRequest(name string) kmip.RequestMessage {
+	var attrs []kmip.Attribute
+	if name != "" {
+		attrs = append(attrs, kmip.Attribute{
+			AttributeName: "Name",
+			AttributeValue: kmip.Name{
+				NameValue: name,
+				NameType:  kmip14.NameTypeUninterpretedTextString,
+			},
+		})
+	}
+
+	return newRequestMessage(kmip14.OperationLocate, kmip.LocateRequestPayload{
+		Attribute: attrs,
+	})
+}
+
+func printLocateResponse(resp kmip.LocateResponsePayload) {
+	if len(resp.UniqueIdentifier) == 0 {
+		fmt.Println("No matching objects.")
+		return
+	}
+	for _, uid := range resp.UniqueIdentifier {
+		fmt.Println(uid)
+	}
+}
+
+func runLocate(args []string) {
+	fs := flag.NewFlagSet("locate", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	name := fs.String("name", "", "Name attribute to match (optional)")
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.LocateResponsePayload
+	if _, err := doOperation(sess, buildLocateRequest(*name), &resp); err != nil {
+		log.Fatalf("Locate failed: %v", err)
+	}
+	printLocateResponse(resp)
+}
+
+func buildRekeyRequest(uid string) kmip.RequestMessage {
+	return newRequestMessage(kmip14.OperationRekey, kmip.RekeyRequestPayload{
+		UniqueIdentifier: uid,
+	})
+}
+
+func printRekeyResponse(resp kmip.RekeyResponsePayload) {
+	fmt.Printf("New Unique Identifier: %s\n", resp.UniqueIdentifier)
+}
+
+func runRekey(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: kmip-cli rekey <unique-identifier>")
+	}
+
+	sess, closeConn, err := oneShotSession(g)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeConn()
+
+	var resp kmip.RekeyResponsePayload
+	if _, err := doOperation(sess, buildRekeyRequest(fs.Arg(0)), &resp); err != nil {
+		log.Fatalf("Rekey failed: %v", err)
+	}
+	printRekeyResponse(resp)
+}
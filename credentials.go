@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CredentialProvider resolves the client's TLS certificate and private key
+// from wherever they actually live. The original behavior - a PEM key and
+// cert on disk - is one implementation among several, since some
+// deployments forbid exporting the private key to disk at all and instead
+// require signing to happen inside an HSM/smartcard or the OS keystore.
+type CredentialProvider interface {
+	ClientCertificate() (tls.Certificate, error)
+}
+
+// resolveCredentialProvider parses the -key flag's URI scheme and returns
+// the matching provider. A bare path with no scheme prefix (the original
+// behavior) is treated as "file:<path>"; any other unrecognized scheme is an
+// error.
+func resolveCredentialProvider(keySpec, certFile string) (CredentialProvider, error) {
+	scheme, rest := splitCredentialScheme(keySpec)
+
+	switch scheme {
+	case "file":
+		return &fileCredentialProvider{keyFile: rest, certFile: certFile}, nil
+	case "pkcs11":
+		return newPKCS11CredentialProvider(rest, certFile)
+	case "keychain":
+		return newKeychainCredentialProvider(rest)
+	case "winstore":
+		return newWinStoreCredentialProvider(rest)
+	default:
+		return nil, fmt.Errorf("unsupported -key scheme %q (want file:, pkcs11:, keychain: or winstore:)", scheme)
+	}
+}
+
+// splitCredentialScheme splits "scheme:rest" into its parts. A bare path
+// with no "://"-free scheme prefix (including a Windows drive letter like
+// "C:\path") is treated as scheme "file".
+func splitCredentialScheme(keySpec string) (scheme, rest string) {
+	i := strings.Index(keySpec, ":")
+	if i <= 1 {
+		return "file", keySpec
+	}
+	return keySpec[:i], keySpec[i+1:]
+}
+
+// fileCredentialProvider is the original behavior: an on-disk PEM key and
+// certificate pair.
+type fileCredentialProvider struct {
+	keyFile  string
+	certFile string
+}
+
+func (p *fileCredentialProvider) ClientCertificate() (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load client key pair: %w", err)
+	}
+	return cert, nil
+}
+
+// loadPEMCertificate reads a single PEM-encoded certificate from path and
+// returns its DER bytes, for credential providers (such as pkcs11:) whose
+// key is on a token but whose certificate is still supplied via -cert.
+func loadPEMCertificate(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file %q: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%q does not contain a PEM certificate", path)
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate in %q: %w", path, err)
+	}
+	return block.Bytes, nil
+}
@@ -0,0 +1,52 @@
+//go:build darwin || windows
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/github/smimesign/certstore"
+)
+
+// findCertstoreIdentity opens store and returns the tls.Certificate for the
+// first identity whose subject contains match. Used by both
+// keychainCredentialProvider (macOS) and winStoreCredentialProvider
+// (Windows), which differ only in which certstore.Open() resolves to and in
+// their error messages.
+func findCertstoreIdentity(storeName, match string) (tls.Certificate, error) {
+	store, err := certstore.Open()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to open %s: %w", storeName, err)
+	}
+	defer store.Close()
+
+	identities, err := store.Identities()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to list %s identities: %w", storeName, err)
+	}
+	for _, id := range identities {
+		defer id.Close()
+
+		cert, err := id.Certificate()
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(cert.Subject.String(), match) {
+			continue
+		}
+
+		signer, err := id.Signer()
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to get signer for %s identity %q: %w", storeName, cert.Subject, err)
+		}
+		return tls.Certificate{
+			Certificate: [][]byte{cert.Raw},
+			PrivateKey:  signer,
+			Leaf:        cert,
+		}, nil
+	}
+
+	return tls.Certificate{}, fmt.Errorf("no %s identity found with subject matching %q", storeName, match)
+}
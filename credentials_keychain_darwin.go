@@ -0,0 +1,28 @@
+//go:build darwin
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// keychainCredentialProvider loads the client certificate and private key
+// from the macOS login keychain, identified by a substring of the
+// certificate's subject (typically the common name). Signing happens
+// inside Security.framework; the private key is never exposed to the
+// process.
+type keychainCredentialProvider struct {
+	match string
+}
+
+func newKeychainCredentialProvider(spec string) (CredentialProvider, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("keychain: URI requires a subject substring to match, e.g. keychain:My Client Cert")
+	}
+	return &keychainCredentialProvider{match: spec}, nil
+}
+
+func (p *keychainCredentialProvider) ClientCertificate() (tls.Certificate, error) {
+	return findCertstoreIdentity("macOS keychain", p.match)
+}
@@ -0,0 +1,12 @@
+//go:build !darwin
+
+package main
+
+import "fmt"
+
+// newKeychainCredentialProvider is a stub on platforms without a macOS
+// login keychain; see credentials_keychain_darwin.go for the real
+// implementation.
+func newKeychainCredentialProvider(spec string) (CredentialProvider, error) {
+	return nil, fmt.Errorf("keychain: credentials require macOS (darwin); this binary was built for a different platform")
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+)
+
+// pkcs11CredentialProvider loads the client certificate and private key from
+// a PKCS#11 token (an HSM or smartcard), per an RFC 7512 "pkcs11:" URI. The
+// private key never leaves the token; signing is delegated to it via
+// pkcs11PrivateKey.
+type pkcs11CredentialProvider struct {
+	ctx      *pkcs11.Ctx
+	session  pkcs11.SessionHandle
+	certFile string
+	object   string
+}
+
+// newPKCS11CredentialProvider parses a PKCS#11 URI's query-like attribute
+// list (module-path, token, object, pin-value) and opens a session against
+// the named token. If certFile is empty, the certificate is also read off
+// the token by matching "object".
+func newPKCS11CredentialProvider(uri, certFile string) (CredentialProvider, error) {
+	attrs, err := parsePKCS11URI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs11 URI: %w", err)
+	}
+
+	modulePath := attrs["module-path"]
+	if modulePath == "" {
+		return nil, fmt.Errorf("pkcs11 URI is missing required %q attribute", "module-path")
+	}
+	object := attrs["object"]
+	if object == "" {
+		return nil, fmt.Errorf("pkcs11 URI is missing required %q attribute", "object")
+	}
+
+	ctx := pkcs11.New(modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+
+	slot, err := findPKCS11Slot(ctx, attrs["token"])
+	if err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+
+	if pin, ok := attrs["pin-value"]; ok {
+		if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+			ctx.CloseSession(session)
+			ctx.Destroy()
+			return nil, fmt.Errorf("failed to log in to PKCS#11 token: %w", err)
+		}
+	}
+
+	return &pkcs11CredentialProvider{ctx: ctx, session: session, certFile: certFile, object: object}, nil
+}
+
+func (p *pkcs11CredentialProvider) ClientCertificate() (tls.Certificate, error) {
+	var certDER []byte
+	if p.certFile != "" {
+		cert, err := loadPEMCertificate(p.certFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		certDER = cert
+	} else {
+		der, err := findPKCS11Object(p.ctx, p.session, pkcs11.CKO_CERTIFICATE, p.object)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to read certificate from token: %w", err)
+		}
+		certDER = der
+	}
+
+	leaf, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse token certificate: %w", err)
+	}
+
+	privHandle, err := findPKCS11ObjectHandle(p.ctx, p.session, pkcs11.CKO_PRIVATE_KEY, p.object)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to find private key on token: %w", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey: &pkcs11PrivateKey{
+			ctx:     p.ctx,
+			session: p.session,
+			handle:  privHandle,
+			public:  leaf.PublicKey,
+		},
+		Leaf: leaf,
+	}, nil
+}
+
+// pkcs11PrivateKey implements crypto.Signer by delegating the Sign
+// operation to the token, so the private key material never has to be
+// extracted.
+type pkcs11PrivateKey struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	handle  pkcs11.ObjectHandle
+	public  crypto.PublicKey
+}
+
+func (k *pkcs11PrivateKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+func (k *pkcs11PrivateKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	mechanism, data, err := pkcs11SignMechanism(k.public, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.ctx.SignInit(k.session, []*pkcs11.Mechanism{mechanism}, k.handle); err != nil {
+		return nil, fmt.Errorf("pkcs11: SignInit failed: %w", err)
+	}
+	sig, err := k.ctx.Sign(k.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: Sign failed: %w", err)
+	}
+	return sig, nil
+}
+
+// pkcs11SignMechanism picks the CKM_* mechanism matching the key type and
+// opts, and returns the bytes to hand to C_Sign (a DigestInfo prefix for
+// RSA PKCS#1v1.5, the raw digest otherwise).
+func pkcs11SignMechanism(pub crypto.PublicKey, digest []byte, opts crypto.SignerOpts) (*pkcs11.Mechanism, []byte, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			alg, ok := pkcs11PSSHashAlgs[pss.Hash]
+			if !ok {
+				return nil, nil, fmt.Errorf("pkcs11: unsupported hash %v for RSA-PSS", pss.Hash)
+			}
+			saltLength := uint(pss.SaltLength)
+			if pss.SaltLength == rsa.PSSSaltLengthEqualsHash {
+				saltLength = uint(pss.Hash.Size())
+			}
+			params := pkcs11.NewPSSParams(alg.hashMechanism, alg.mgf, saltLength)
+			return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params), digest, nil
+		}
+		prefix, ok := rsaPKCS1DigestPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, nil, fmt.Errorf("pkcs11: unsupported hash %v for RSA PKCS#1v1.5", opts.HashFunc())
+		}
+		return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil), append(prefix, digest...), nil
+	case *ecdsa.PublicKey:
+		return pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest, nil
+	default:
+		return nil, nil, fmt.Errorf("pkcs11: unsupported public key type %T", pub)
+	}
+}
+
+// pkcs11PSSHashAlgs maps a crypto.Hash to the CKM_* hash mechanism and
+// CKG_MGF1_* mask generation function CK_RSA_PKCS_PSS_PARAMS expects.
+var pkcs11PSSHashAlgs = map[crypto.Hash]struct{ hashMechanism, mgf uint }{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+var rsaPKCS1DigestPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// parsePKCS11URI parses the semicolon-separated attribute list of an RFC
+// 7512 "pkcs11:" URI (the scheme itself has already been stripped by
+// splitCredentialScheme) into a flat map, percent-decoding each value.
+func parsePKCS11URI(rest string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	// RFC 7512 allows both path attributes (token, object, ...) and
+	// query attributes (module-path, pin-value, ...), separated by "?".
+	// We don't need to distinguish them here; both are "name=value" pairs
+	// joined by ";" or "&".
+	rest = strings.NewReplacer("?", ";", "&", ";").Replace(rest)
+	for _, pair := range strings.Split(rest, ";") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed attribute %q", pair)
+		}
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed attribute %q: %w", pair, err)
+		}
+		attrs[kv[0]] = value
+	}
+	return attrs, nil
+}
+
+func findPKCS11Slot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	if tokenLabel == "" {
+		if len(slots) == 0 {
+			return 0, fmt.Errorf("no PKCS#11 slots with a token present")
+		}
+		return slots[0], nil
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if strings.TrimRight(info.Label, " ") == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no PKCS#11 token labeled %q", tokenLabel)
+}
+
+func findPKCS11ObjectHandle(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("FindObjectsInit failed: %w", err)
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	handles, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return 0, fmt.Errorf("FindObjects failed: %w", err)
+	}
+	if len(handles) == 0 {
+		return 0, fmt.Errorf("no object labeled %q found", label)
+	}
+	return handles[0], nil
+}
+
+func findPKCS11Object(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, label string) ([]byte, error) {
+	handle, err := findPKCS11ObjectHandle(ctx, session, class, label)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetAttributeValue failed: %w", err)
+	}
+	return attrs[0].Value, nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// newWinStoreCredentialProvider is a stub on platforms without a Windows
+// certificate store; see credentials_winstore_windows.go for the real
+// implementation.
+func newWinStoreCredentialProvider(spec string) (CredentialProvider, error) {
+	return nil, fmt.Errorf("winstore: credentials require Windows; this binary was built for a different platform")
+}
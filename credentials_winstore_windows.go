@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// winStoreCredentialProvider loads the client certificate and private key
+// from the Windows "My" certificate store, identified by a substring of the
+// certificate's subject. Signing is delegated to CNG/CryptoAPI, so the
+// private key never leaves the store (and can be backed by a TPM).
+type winStoreCredentialProvider struct {
+	match string
+}
+
+func newWinStoreCredentialProvider(spec string) (CredentialProvider, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("winstore: URI requires a subject substring to match, e.g. winstore:My Client Cert")
+	}
+	return &winStoreCredentialProvider{match: spec}, nil
+}
+
+func (p *winStoreCredentialProvider) ClientCertificate() (tls.Certificate, error) {
+	return findCertstoreIdentity("Windows certificate store", p.match)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	ttlv2 "github.com/gemalto/kmip-go/ttlv"
+)
+
+// Frame directions recorded in a -dump file, one byte each so the format
+// stays trivial to parse without pulling in the TTLV decoder just to find
+// frame boundaries.
+const (
+	dumpDirectionRequest  byte = 'C' // client -> server
+	dumpDirectionResponse byte = 'S' // server -> client
+)
+
+// dumpFrame is one captured request or response: a direction, the time it
+// was sent/received, and the raw TTLV bytes.
+type dumpFrame struct {
+	Direction byte
+	Time      time.Time
+	Payload   ttlv2.TTLV
+}
+
+// writeDumpFrame appends one length-prefixed frame to w: 1 byte direction,
+// 8 bytes big-endian Unix nanoseconds, 4 bytes big-endian payload length,
+// then the raw TTLV bytes.
+func writeDumpFrame(w io.Writer, direction byte, t time.Time, payload []byte) error {
+	header := make([]byte, 1+8+4)
+	header[0] = direction
+	binary.BigEndian.PutUint64(header[1:9], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write dump frame header: %w", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("failed to write dump frame payload: %w", err)
+	}
+	return nil
+}
+
+// readDumpFrames reads every frame written by writeDumpFrame from path, in
+// order.
+func readDumpFrames(path string) ([]dumpFrame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dump file %q: %w", path, err)
+	}
+	defer f.Close()
+
+	var frames []dumpFrame
+	header := make([]byte, 1+8+4)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read dump frame header: %w", err)
+		}
+
+		direction := header[0]
+		frameTime := time.Unix(0, int64(binary.BigEndian.Uint64(header[1:9])))
+		length := binary.BigEndian.Uint32(header[9:13])
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(f, payload); err != nil {
+			return nil, fmt.Errorf("failed to read dump frame payload: %w", err)
+		}
+
+		frames = append(frames, dumpFrame{Direction: direction, Time: frameTime, Payload: ttlv2.TTLV(payload)})
+	}
+	return frames, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	ttlv2 "github.com/gemalto/kmip-go/ttlv"
+)
+
+// jsonToHex converts a TTLV JSON document (the KMIP 2.x JSON encoding
+// profile - tag names, typed values, nested structures) read from r into
+// its hex-encoded wire representation.
+func jsonToHex(r io.Reader) (string, error) {
+	var raw ttlv2.TTLV
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		if err == io.EOF {
+			return "", nil
+		}
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// marshalResponse renders response in the given output format. JSON and XML
+// both go through ttlv.TTLV's own Marshaler, which resolves tag, enum and
+// mask values to their human-readable names using the kmip14 registry
+// instead of printing raw integers.
+func marshalResponse(response ttlv2.TTLV, format string, pretty bool) ([]byte, error) {
+	switch format {
+	case "json":
+		if pretty {
+			return json.MarshalIndent(response, "", "  ")
+		}
+		return json.Marshal(response)
+	case "xml":
+		if pretty {
+			return xml.MarshalIndent(response, "", "  ")
+		}
+		return xml.Marshal(response)
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
@@ -11,63 +10,178 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/gemalto/kmip-go"
-	"github.com/gemalto/kmip-go/kmip14"
 	ttlv2 "github.com/gemalto/kmip-go/ttlv"
 )
 
+// defaultProtocolVersionMajor/Minor are the KMIP protocol version used when
+// building request headers, matching the version the ceph-csi KMIP
+// integration pins to.
+const (
+	defaultProtocolVersionMajor = 1
+	defaultProtocolVersionMinor = 4
+)
+
+// globalFlags holds the connection-related flags shared by every subcommand.
+type globalFlags struct {
+	serverAddr   *string
+	keyFile      *string
+	certFile     *string
+	caFile       *string
+	protocol     *string
+	dialTimeout  *time.Duration
+	readTimeout  *time.Duration
+	writeTimeout *time.Duration
+	dumpFile     *string
+	trace        *bool
+}
+
+func registerGlobalFlags(fs *flag.FlagSet) *globalFlags {
+	return &globalFlags{
+		serverAddr:   fs.String("server", "", "KMIP server address and port (e.g., localhost:5696) (required)"),
+		keyFile:      fs.String("key", "", "Client private key: a PEM file path, or file:/pkcs11:/keychain:/winstore: URI (required)"),
+		certFile:     fs.String("cert", "", "Client certificate file in PEM format (optional for pkcs11: keys, whose certificate is otherwise read from the token; ignored for keychain:/winstore: keys)"),
+		caFile:       fs.String("cacert", "", "CA certificate file in PEM format for server verification (optional)"),
+		protocol:     fs.String("protocol", "", "KMIP protocol version to use: 1.4, 2.0 or 2.1. If unset, negotiated via Discover Versions. 2.0/2.1 only set the header version - payloads are still kmip14-shaped (optional)"),
+		dialTimeout:  fs.Duration("dial-timeout", 10*time.Second, "Timeout for establishing the TLS connection (optional)"),
+		readTimeout:  fs.Duration("read-timeout", 30*time.Second, "Timeout for reading a response once a request has been sent; 0 disables it (optional)"),
+		writeTimeout: fs.Duration("write-timeout", 10*time.Second, "Timeout for writing a request; 0 disables it (optional)"),
+		dumpFile:     fs.String("dump", "", "Capture every request/response as length-prefixed TTLV frames to this file, for later use with the replay subcommand (optional)"),
+		trace:        fs.Bool("trace", false, "Pretty-print each request/response frame as annotated TTLV to stderr as it's sent/received (optional)"),
+	}
+}
+
+func (g *globalFlags) validate() error {
+	if *g.serverAddr == "" || *g.keyFile == "" {
+		return fmt.Errorf("-server and -key are required")
+	}
+	return nil
+}
+
+// connect resolves creds (once, by the caller, so repeated redials of a
+// pkcs11:/keychain:/winstore: key don't re-open a fresh token session every
+// time) into a TLS connection.
+func (g *globalFlags) connect(creds CredentialProvider) (*tls.Conn, error) {
+	return setupConnection(creds, *g.serverAddr, *g.caFile, *g.dialTimeout)
+}
+
+// newSession dials a fresh connection and wraps it in a Session configured
+// with this invocation's read/write timeouts and a redialer that repeats
+// the same dial, for callers that want automatic reconnect (REPL mode).
+func (g *globalFlags) newSession() (*Session, error) {
+	creds, err := resolveCredentialProvider(*g.keyFile, *g.certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := g.connect(creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish connection: %w", err)
+	}
+	sess := NewSession(conn)
+	sess.SetTimeouts(*g.readTimeout, *g.writeTimeout)
+	sess.SetRedialer(func() (io.ReadWriter, error) {
+		c, err := g.connect(creds)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+
+	if *g.dumpFile != "" {
+		f, err := os.Create(*g.dumpFile)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create -dump file %q: %w", *g.dumpFile, err)
+		}
+		sess.SetDumpWriter(f)
+	}
+	if *g.trace {
+		sess.SetTraceWriter(os.Stderr)
+	}
+
+	return sess, nil
+}
+
 func main() {
-	// Define flags
-	serverAddr := flag.String("server", "", "KMIP server address and port (e.g., localhost:5696) (required)")
-	keyFile := flag.String("key", "", "Client private key file in PEM format (required)")
-	certFile := flag.String("cert", "", "Client certificate file in PEM format (required)")
-	caFile := flag.String("cacert", "", "CA certificate file in PEM format for server verification (optional)")
-	inputFile := flag.String("in", "", "Input file for the KMIP request. If not specified, reads from stdin (optional)")
-	inputFormat := flag.String("input-format", "hex", "The format of the input request. Can be 'hex' or 'xml' (optional)")
-	outputFormat := flag.String("output-format", "hex", "The format for printing the response. Can be 'hex' or 'xml' (optional)")
-	help := flag.Bool("help", false, "Show help message (optional)")
-
-	flag.Usage = printCustomHelp
-	flag.Parse()
-
-	if *help || *serverAddr == "" || *keyFile == "" || *certFile == "" {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		printCustomHelp()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "-help", "--help", "help":
 		printCustomHelp()
 		return
+	case "raw":
+		runRaw(os.Args[2:])
+	case "create":
+		runCreate(os.Args[2:])
+	case "get":
+		runGet(os.Args[2:])
+	case "activate":
+		runActivate(os.Args[2:])
+	case "destroy":
+		runDestroy(os.Args[2:])
+	case "register":
+		runRegister(os.Args[2:])
+	case "locate":
+		runLocate(os.Args[2:])
+	case "rekey":
+		runRekey(os.Args[2:])
+	case "shell":
+		runShell(os.Args[2:])
+	case "replay":
+		runReplay(os.Args[2:])
+	default:
+		printCustomHelp()
+		os.Exit(1)
 	}
+}
 
-	// setup logger
-	log.SetFlags(0)
+// runRaw implements the original raw hex/XML passthrough behavior.
+func runRaw(args []string) {
+	fs := flag.NewFlagSet("raw", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	inputFile := fs.String("in", "", "Input file for the KMIP request. If not specified, reads from stdin (optional)")
+	inputFormat := fs.String("input-format", "hex", "The format of the input request. Can be 'hex', 'xml' or 'json' (optional)")
+	outputFormat := fs.String("output-format", "hex", "The format for printing the response. Can be 'hex', 'xml' or 'json' (optional)")
+	pretty := fs.Bool("pretty", false, "Pretty-print XML/JSON output (optional)")
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
 
-	// Create client connection
-	conn, err := setupConnection(*serverAddr, *keyFile, *certFile, *caFile)
+	sess, err := g.newSession()
 	if err != nil {
-		log.Fatalf("Failed to establish connection: %v", err)
+		log.Fatalf("%v", err)
 	}
-	defer conn.Close()
+	defer sess.Close()
 
-	// Read request
 	requestBytes, err := readRequest(*inputFile, *inputFormat)
 	if err != nil {
 		log.Fatalf("Failed to read request: %v", err)
 	}
 
-	// Send request and get response
-	responseTTLV, _, err := sendRequest(conn, requestBytes)
+	responseTTLV, _, err := sess.Send(requestBytes)
 	if err != nil {
 		log.Fatalf("Failed to send request: %v", err)
 	}
 
-	// Print response
-	if err := printResponse(responseTTLV, *outputFormat); err != nil {
+	if err := printResponse(responseTTLV, *outputFormat, *pretty); err != nil {
 		log.Fatalf("Failed to print response: %v", err)
 	}
 }
 
-func setupConnection(serverAddr, keyFile, certFile, caFile string) (*tls.Conn, error) {
-	cer, err := tls.LoadX509KeyPair(certFile, keyFile)
+func setupConnection(creds CredentialProvider, serverAddr, caFile string, dialTimeout time.Duration) (*tls.Conn, error) {
+	cer, err := creds.ClientCertificate()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load client key pair: %w", err)
 	}
@@ -90,7 +204,12 @@ func setupConnection(serverAddr, keyFile, certFile, caFile string) (*tls.Conn, e
 		conf.InsecureSkipVerify = true
 	}
 
-	conn, err := tls.Dial("tcp", serverAddr, conf)
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", serverAddr, conf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to server: %w", err)
 	}
@@ -118,69 +237,34 @@ func readRequest(inputFile, inputFormat string) ([]byte, error) {
 
 	requestStr := strings.TrimSpace(string(requestBytes))
 
-	if inputFormat == "xml" {
+	switch inputFormat {
+	case "xml":
 		hexRequest, err := xmlToHex(strings.NewReader(requestStr))
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert XML request to hex: %w", err)
 		}
 		return hex.DecodeString(hexRequest)
-	}
-
-	return hex.DecodeString(requestStr)
-}
-
-func sendRequest(conn io.ReadWriter, request []byte) (ttlv2.TTLV, string, error) {
-	_, err := conn.Write(request)
-	if err != nil {
-		return nil, "Unable to write request", err
-	}
-
-	decoder := ttlv2.NewDecoder(bufio.NewReader(conn))
-	resp, err := decoder.NextTTLV()
-	if err != nil {
-		return nil, "Unable to decode response TTLV", err
-	}
-
-	var respMsg kmip.ResponseMessage
-	err = decoder.DecodeValue(&respMsg, resp)
-	if err != nil {
-		// still return the raw response even if decoding fails
-		return resp, "", fmt.Errorf("failed to decode response message: %w", err)
-	}
-
-	// // Check header result status
-	// if respMsg.ResponseHeader.ResultStatus != kmip14.ResultStatusSuccess {
-	// 	return resp, "", fmt.Errorf("KMIP batch operation failed: %s - %s",
-	// 		respMsg.ResponseHeader.ResultStatus.String(),
-	// 		respMsg.ResponseHeader.ResultMessage)
-	// }
-
-	// Check each batch item's result status
-	for i, item := range respMsg.BatchItem {
-		if item.ResultStatus != kmip14.ResultStatusSuccess {
-			return resp, "", fmt.Errorf("KMIP operation in batch item %d failed: %s - %s",
-				i,
-				item.ResultStatus.String(),
-				item.ResultMessage)
+	case "json":
+		hexRequest, err := jsonToHex(strings.NewReader(requestStr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert JSON request to hex: %w", err)
 		}
+		return hex.DecodeString(hexRequest)
+	default:
+		return hex.DecodeString(requestStr)
 	}
-
-	hexResponse := fmt.Sprintf("%x", []byte(resp))
-	return resp, hexResponse, nil
 }
 
-func printResponse(response ttlv2.TTLV, format string) error {
+func printResponse(response ttlv2.TTLV, format string, pretty bool) error {
 	switch format {
-	case "xml":
-		s, err := xml.MarshalIndent(response, "", "  ")
-		if err != nil {
-			return fmt.Errorf("error printing XML: %w", err)
-		}
-		fmt.Println(string(s))
 	case "hex":
 		fmt.Println(hex.EncodeToString(response))
 	default:
-		return fmt.Errorf("unknown output format: %s", format)
+		s, err := marshalResponse(response, format, pretty)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(s))
 	}
 	return nil
 }
@@ -201,9 +285,28 @@ func xmlToHex(r io.Reader) (string, error) {
 func printCustomHelp() {
 	fmt.Println("A command-line tool for sending KMIP requests to a server.")
 	fmt.Println("\nUsage:")
-	fmt.Println("  kmip-cli -server <ip:port> -key <keyfile> -cert <certfile> [options]")
-	fmt.Println("\nOptions:")
-	flag.PrintDefaults()
+	fmt.Println("  kmip-cli <command> -server <ip:port> -key <keyfile> -cert <certfile> [options]")
+	fmt.Println("\nCommands:")
+	fmt.Println("  create    Create a new cryptographic object")
+	fmt.Println("  get       Retrieve an object by unique identifier")
+	fmt.Println("  activate  Activate an object")
+	fmt.Println("  destroy   Destroy an object")
+	fmt.Println("  register  Register (import) an existing key from a file")
+	fmt.Println("  locate    Locate objects matching given attributes")
+	fmt.Println("  rekey     Rekey an existing key")
+	fmt.Println("  raw       Send a raw hex/XML/JSON TTLV request (original behavior)")
+	fmt.Println("  shell     Start an interactive REPL over a single persistent connection")
+	fmt.Println("  replay    Replay a -dump file against a server, or print it offline")
+	fmt.Println("\nAll commands except 'raw' and 'replay' use -protocol (1.4, 2.0 or 2.1); if omitted, the")
+	fmt.Println("version is negotiated with the server via Discover Versions. Request/response")
+	fmt.Println("payloads are always kmip14-shaped; picking (or negotiating) 2.0/2.1 only sets")
+	fmt.Println("the header version and prints a warning, since a conformant 2.x-only server")
+	fmt.Println("may reject the kmip14 payload shape.")
+	fmt.Println("\n-key also accepts pkcs11:, keychain: and winstore: URIs, for deployments where")
+	fmt.Println("the client private key must not be exported to disk.")
+	fmt.Println("\n-dump <file> captures every request/response as TTLV frames for later replay;")
+	fmt.Println("-trace pretty-prints each frame to stderr as it's sent/received.")
+	fmt.Println("\nRun 'kmip-cli <command> -help' for command-specific options.")
 	fmt.Println("\nExample:")
-	fmt.Println(`  echo "42007801..." | kmip-cli -server localhost:5696 -key client.key -cert client.pem`)
+	fmt.Println(`  kmip-cli create -server localhost:5696 -key client.key -cert client.pem -alg AES -len 256 -name mykey`)
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	"github.com/gemalto/kmip-go/ttlv"
+)
+
+// protocolVersion identifies a negotiated KMIP wire version. It is used for
+// version negotiation (via -protocol or DiscoverVersions) and reported in
+// the request header only; request/response payloads are always built and
+// decoded with the kmip14 tag set, so -protocol 2.0/2.1 should only be used
+// against servers that still accept kmip14-shaped payloads under a 2.x
+// header.
+type protocolVersion struct {
+	major int
+	minor int
+}
+
+func (v protocolVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+var (
+	protocolVersion14 = protocolVersion{major: 1, minor: 4}
+	protocolVersion20 = protocolVersion{major: 2, minor: 0}
+	protocolVersion21 = protocolVersion{major: 2, minor: 1}
+)
+
+// supportedProtocolVersions lists every version this client can speak, most
+// preferred first; it's also what gets offered in a DiscoverVersions call.
+var supportedProtocolVersions = []protocolVersion{protocolVersion21, protocolVersion20, protocolVersion14}
+
+func parseProtocolVersion(s string) (protocolVersion, error) {
+	switch s {
+	case "1.4":
+		return protocolVersion14, nil
+	case "2.0":
+		return protocolVersion20, nil
+	case "2.1":
+		return protocolVersion21, nil
+	default:
+		return protocolVersion{}, fmt.Errorf("unsupported -protocol %q (want one of 1.4, 2.0, 2.1)", s)
+	}
+}
+
+// negotiateProtocolVersion sends a DiscoverVersions request offering every
+// version this client supports and returns the highest version the server
+// also reports supporting. Servers that don't implement DiscoverVersions
+// (or that error on it) are assumed to only speak 1.4, the version the
+// ceph-csi KMIP integration this client was modeled on pins to.
+func negotiateProtocolVersion(sess *Session) (protocolVersion, error) {
+	req := kmip.RequestMessage{
+		RequestHeader: kmip.RequestHeader{
+			ProtocolVersion: kmip.ProtocolVersion{ProtocolVersionMajor: 1, ProtocolVersionMinor: 0},
+			BatchCount:      1,
+		},
+		BatchItem: []kmip.RequestBatchItem{
+			{
+				Operation: kmip14.OperationDiscoverVersions,
+				RequestPayload: kmip.DiscoverVersionsRequestPayload{
+					ProtocolVersion: protocolVersionsToKMIP(supportedProtocolVersions),
+				},
+			},
+		},
+	}
+
+	reqTTLV, err := ttlv.Marshal(req)
+	if err != nil {
+		return protocolVersion14, fmt.Errorf("failed to encode DiscoverVersions request: %w", err)
+	}
+
+	respTTLV, _, err := sess.Send(reqTTLV)
+	if err != nil {
+		return protocolVersion14, nil
+	}
+
+	var respMsg kmip.ResponseMessage
+	if err := ttlv.Unmarshal(respTTLV, &respMsg); err != nil {
+		return protocolVersion14, fmt.Errorf("failed to decode DiscoverVersions response: %w", err)
+	}
+	if len(respMsg.BatchItem) == 0 {
+		return protocolVersion14, nil
+	}
+
+	var payload kmip.DiscoverVersionsResponsePayload
+	if err := ttlv.Unmarshal(respMsg.BatchItem[0].ResponsePayload.(ttlv.TTLV), &payload); err != nil {
+		return protocolVersion14, fmt.Errorf("failed to decode DiscoverVersions payload: %w", err)
+	}
+
+	var best protocolVersion
+	for _, v := range payload.ProtocolVersion {
+		pv := protocolVersion{major: v.ProtocolVersionMajor, minor: v.ProtocolVersionMinor}
+		if pv.major > best.major || (pv.major == best.major && pv.minor > best.minor) {
+			best = pv
+		}
+	}
+	if best.major == 0 {
+		return protocolVersion14, nil
+	}
+	return best, nil
+}
+
+func protocolVersionsToKMIP(versions []protocolVersion) []kmip.ProtocolVersion {
+	out := make([]kmip.ProtocolVersion, len(versions))
+	for i, v := range versions {
+		out[i] = kmip.ProtocolVersion{ProtocolVersionMajor: v.major, ProtocolVersionMinor: v.minor}
+	}
+	return out
+}
+
+// resolveProtocolVersion returns the version set explicitly via -protocol,
+// or negotiates one over sess when the flag was left unspecified. Either
+// way, a resulting 2.x version is flagged via warnIfKMIP2: this client
+// always builds and decodes payloads with the kmip14 tag set (see
+// protocolVersion's doc comment), so a 2.x header is only safe against
+// servers that still accept that legacy shape.
+func resolveProtocolVersion(sess *Session, explicit string) (protocolVersion, error) {
+	var version protocolVersion
+	var err error
+	if explicit != "" {
+		version, err = parseProtocolVersion(explicit)
+	} else {
+		version, err = negotiateProtocolVersion(sess)
+	}
+	if err != nil {
+		return version, err
+	}
+	warnIfKMIP2(version)
+	return version, nil
+}
+
+// warnIfKMIP2 prints a loud stderr warning when version is 2.x, since every
+// request/response payload this client sends is still kmip14-shaped (e.g.
+// TemplateAttribute, which KMIP 2.0 removed); a conformant 2.x-only server
+// will reject them.
+func warnIfKMIP2(version protocolVersion) {
+	if version.major >= 2 {
+		fmt.Fprintf(os.Stderr, "warning: using KMIP %s, but this client only builds/decodes kmip14-shaped payloads; "+
+			"a conformant KMIP 2.x server may reject every request\n", version)
+	}
+}
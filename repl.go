@@ -0,0 +1,369 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	"github.com/gemalto/kmip-go/ttlv"
+)
+
+// runShell implements the interactive REPL: a single TLS connection and
+// TTLV decoder are kept alive for the whole session (via Session), so
+// commands can be issued one after another the way psql or redis-cli work.
+func runShell(args []string) {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	g := registerGlobalFlags(fs)
+	fs.Parse(args)
+
+	if err := g.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	sess, err := g.newSession()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer sess.Close()
+
+	version, err := resolveProtocolVersion(sess, *g.protocol)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	sess.SetVersion(version)
+	fmt.Printf("negotiated KMIP protocol version %s\n", version)
+
+	repl := &replState{sess: sess}
+	if err := repl.run(); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// replState tracks the REPL's in-progress batch, if any.
+type replState struct {
+	sess      *Session
+	batching  bool
+	batchOps  []kmip.RequestBatchItem
+	batchCmds []string // command name queued alongside the matching batchOps entry, for bindResult after 'batch send'
+}
+
+// replHistoryFile returns the path used to persist REPL line history across
+// invocations, similar to psql's ~/.psql_history.
+func replHistoryFile() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".kmip-cli_history")
+	}
+	return filepath.Join(os.TempDir(), ".kmip-cli_history")
+}
+
+func (r *replState) run() error {
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:      "kmip> ",
+		HistoryFile: replHistoryFile(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start REPL: %w", err)
+	}
+	defer rl.Close()
+
+	fmt.Println("kmip-cli shell. Type 'help' for commands, 'exit' to quit.")
+	for {
+		line, err := rl.Readline()
+		if err != nil {
+			if err == readline.ErrInterrupt {
+				continue
+			}
+			break // io.EOF (Ctrl-D) or a read error
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			break
+		}
+		r.dispatch(line)
+	}
+	return nil
+}
+
+func (r *replState) dispatch(line string) {
+	fields := strings.Fields(r.expand(line))
+	cmd, cmdArgs := fields[0], fields[1:]
+
+	switch cmd {
+	case "help":
+		printReplHelp()
+		return
+	case "batch":
+		r.handleBatch(cmdArgs)
+		return
+	}
+
+	op, payload, err := buildPayload(cmd, cmdArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return
+	}
+
+	if r.batching {
+		r.batchOps = append(r.batchOps, kmip.RequestBatchItem{
+			Operation:      op,
+			RequestPayload: payload,
+		})
+		r.batchCmds = append(r.batchCmds, cmd)
+		fmt.Printf("queued %s (%d in batch)\n", cmd, len(r.batchOps))
+		return
+	}
+
+	start := time.Now()
+	req := newRequestMessage(op, payload)
+	item, err := r.send(req)
+	if isBroken(err) {
+		item, err = r.sendAfterReconnect(req)
+	}
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v (%s)\n", err, elapsed)
+		return
+	}
+	r.bindResult(cmd, item)
+	fmt.Printf("(%s)\n", elapsed)
+}
+
+func (r *replState) handleBatch(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: batch begin|send")
+		return
+	}
+	switch args[0] {
+	case "begin":
+		r.batching = true
+		r.batchOps = nil
+		r.batchCmds = nil
+		fmt.Println("batch started; queue commands, then run 'batch send'")
+	case "send":
+		if !r.batching {
+			fmt.Fprintln(os.Stderr, "no batch in progress; run 'batch begin' first")
+			return
+		}
+		r.batching = false
+		if len(r.batchOps) == 0 {
+			fmt.Println("batch was empty, nothing sent")
+			return
+		}
+		cmds := r.batchCmds
+		start := time.Now()
+		req := newBatchRequestMessage(r.batchOps)
+		req.RequestHeader.ProtocolVersion = kmip.ProtocolVersion{
+			ProtocolVersionMajor: r.sess.version.major,
+			ProtocolVersionMinor: r.sess.version.minor,
+		}
+		reqTTLV, err := ttlv.Marshal(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to encode batch: %v\n", err)
+			r.batchOps, r.batchCmds = nil, nil
+			return
+		}
+		respTTLV, _, err := r.sess.Send(reqTTLV)
+		if isBroken(err) {
+			if rerr := r.sess.ReconnectWithBackoff(5); rerr == nil {
+				respTTLV, _, err = r.sess.Send(reqTTLV)
+			}
+		}
+		elapsed := time.Since(start)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v (%s)\n", err, elapsed)
+			r.batchOps, r.batchCmds = nil, nil
+			return
+		}
+		var respMsg kmip.ResponseMessage
+		if err := ttlv.Unmarshal(respTTLV, &respMsg); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to decode batch response: %v\n", err)
+			r.batchOps, r.batchCmds = nil, nil
+			return
+		}
+		for i, item := range respMsg.BatchItem {
+			fmt.Printf("batch item %d: %s\n", i, item.ResultStatus.String())
+			if i < len(cmds) && item.ResultStatus == kmip14.ResultStatusSuccess {
+				r.bindResult(cmds[i], &item)
+			}
+		}
+		fmt.Printf("(%s)\n", elapsed)
+		r.batchOps, r.batchCmds = nil, nil
+	default:
+		fmt.Fprintln(os.Stderr, "usage: batch begin|send")
+	}
+}
+
+// sendAfterReconnect re-dials with exponential backoff and retries req once,
+// used when send's first attempt failed with what looks like a dropped
+// connection rather than a KMIP-level error.
+func (r *replState) sendAfterReconnect(req kmip.RequestMessage) (*kmip.ResponseBatchItem, error) {
+	fmt.Fprintln(os.Stderr, "connection appears broken, reconnecting...")
+	if err := r.sess.ReconnectWithBackoff(5); err != nil {
+		return nil, err
+	}
+	return r.send(req)
+}
+
+// send runs a single request message through the session and returns its
+// lone batch item, surfacing any KMIP-level failure as an error.
+func (r *replState) send(req kmip.RequestMessage) (*kmip.ResponseBatchItem, error) {
+	req.RequestHeader.ProtocolVersion = kmip.ProtocolVersion{
+		ProtocolVersionMajor: r.sess.version.major,
+		ProtocolVersionMinor: r.sess.version.minor,
+	}
+
+	reqTTLV, err := ttlv.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	respTTLV, _, err := r.sess.Send(reqTTLV)
+	if err != nil {
+		return nil, err
+	}
+
+	var respMsg kmip.ResponseMessage
+	if err := ttlv.Unmarshal(respTTLV, &respMsg); err != nil {
+		return nil, fmt.Errorf("failed to decode response message: %w", err)
+	}
+	if len(respMsg.BatchItem) == 0 {
+		return nil, fmt.Errorf("response contained no batch items")
+	}
+	item := respMsg.BatchItem[0]
+	if item.ResultStatus != kmip14.ResultStatusSuccess {
+		return &item, fmt.Errorf("operation failed: %s - %s", item.ResultStatus.String(), item.ResultMessage)
+	}
+	return &item, nil
+}
+
+// bindResult records $last.uid from a create, register or rekey response so
+// later commands in the session can reference it.
+func (r *replState) bindResult(cmd string, item *kmip.ResponseBatchItem) {
+	var uid string
+	switch cmd {
+	case "create":
+		var resp kmip.CreateResponsePayload
+		if err := ttlv.Unmarshal(item.ResponsePayload.(ttlv.TTLV), &resp); err == nil {
+			uid = resp.UniqueIdentifier
+		}
+	case "register":
+		var resp kmip.RegisterResponsePayload
+		if err := ttlv.Unmarshal(item.ResponsePayload.(ttlv.TTLV), &resp); err == nil {
+			uid = resp.UniqueIdentifier
+		}
+	case "rekey":
+		var resp kmip.RekeyResponsePayload
+		if err := ttlv.Unmarshal(item.ResponsePayload.(ttlv.TTLV), &resp); err == nil {
+			uid = resp.UniqueIdentifier
+		}
+	}
+	if uid != "" {
+		r.sess.SetVar("last.uid", uid)
+		fmt.Printf("Unique Identifier: %s\n", uid)
+	}
+}
+
+// expand substitutes $name references (e.g. $last.uid) with values recorded
+// from earlier responses in this session.
+func (r *replState) expand(line string) string {
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if strings.HasPrefix(f, "$") {
+			if v, ok := r.sess.Var(strings.TrimPrefix(f, "$")); ok {
+				fields[i] = v
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// buildPayload parses a REPL command line (already variable-expanded) into
+// the KMIP operation and payload it represents, sharing the same attribute
+// construction the one-shot subcommands use.
+func buildPayload(cmd string, args []string) (kmip14.Operation, interface{}, error) {
+	switch cmd {
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ContinueOnError)
+		alg := fs.String("alg", "AES", "")
+		length := fs.Int("len", 256, "")
+		name := fs.String("name", "", "")
+		if err := fs.Parse(args); err != nil {
+			return 0, nil, err
+		}
+		payload, err := createPayload(*alg, *length, *name)
+		return kmip14.OperationCreate, payload, err
+	case "get":
+		if len(args) != 1 {
+			return 0, nil, fmt.Errorf("usage: get <unique-identifier>")
+		}
+		return kmip14.OperationGet, kmip.GetRequestPayload{UniqueIdentifier: args[0]}, nil
+	case "activate":
+		if len(args) != 1 {
+			return 0, nil, fmt.Errorf("usage: activate <unique-identifier>")
+		}
+		return kmip14.OperationActivate, kmip.ActivateRequestPayload{UniqueIdentifier: args[0]}, nil
+	case "destroy":
+		if len(args) != 1 {
+			return 0, nil, fmt.Errorf("usage: destroy <unique-identifier>")
+		}
+		return kmip14.OperationDestroy, kmip.DestroyRequestPayload{UniqueIdentifier: args[0]}, nil
+	case "register":
+		fs := flag.NewFlagSet("register", flag.ContinueOnError)
+		keyFile := fs.String("key-file", "", "")
+		alg := fs.String("alg", "AES", "")
+		length := fs.Int("len", 256, "")
+		name := fs.String("name", "", "")
+		if err := fs.Parse(args); err != nil {
+			return 0, nil, err
+		}
+		if *keyFile == "" {
+			return 0, nil, fmt.Errorf("-key-file is required")
+		}
+		keyMaterial, err := os.ReadFile(*keyFile)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read key material file %q: %w", *keyFile, err)
+		}
+		payload, err := registerPayload(keyMaterial, *alg, *length, *name)
+		return kmip14.OperationRegister, payload, err
+	case "locate":
+		fs := flag.NewFlagSet("locate", flag.ContinueOnError)
+		name := fs.String("name", "", "")
+		if err := fs.Parse(args); err != nil {
+			return 0, nil, err
+		}
+		var attrs []kmip.Attribute
+		if *name != "" {
+			attrs = append(attrs, kmip.Attribute{
+				AttributeName:  "Name",
+				AttributeValue: kmip.Name{NameValue: *name, NameType: kmip14.NameTypeUninterpretedTextString},
+			})
+		}
+		return kmip14.OperationLocate, kmip.LocateRequestPayload{Attribute: attrs}, nil
+	case "rekey":
+		if len(args) != 1 {
+			return 0, nil, fmt.Errorf("usage: rekey <unique-identifier>")
+		}
+		return kmip14.OperationRekey, kmip.RekeyRequestPayload{UniqueIdentifier: args[0]}, nil
+	default:
+		return 0, nil, fmt.Errorf("unknown command %q (try 'help')", cmd)
+	}
+}
+
+func printReplHelp() {
+	fmt.Println("Commands: create, get, activate, destroy, register, locate, rekey")
+	fmt.Println("          batch begin | batch send")
+	fmt.Println("          exit | quit")
+	fmt.Println("Use $last.uid to refer to the UniqueIdentifier returned by the previous create/register/rekey")
+	fmt.Println("(bound after each queued batch item too, in batch order). Up/down arrows recall")
+	fmt.Println("previous lines; history persists across sessions in ~/.kmip-cli_history.")
+}
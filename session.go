@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/gemalto/kmip-go"
+	"github.com/gemalto/kmip-go/kmip14"
+	ttlv2 "github.com/gemalto/kmip-go/ttlv"
+)
+
+// Session wraps a connection and keeps the TTLV decoder alive across
+// multiple requests, so REPL mode and batched operations can share one TLS
+// connection instead of paying a fresh handshake per command.
+type Session struct {
+	conn         io.ReadWriter
+	decoder      *ttlv2.Decoder
+	vars         map[string]string
+	version      protocolVersion
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	redial       func() (io.ReadWriter, error)
+	dump         io.Writer
+	trace        io.Writer
+}
+
+// NewSession wraps conn in a Session ready to send requests. The protocol
+// version defaults to 1.4 until SetVersion is called, e.g. after
+// resolveProtocolVersion negotiates or the user pins one via -protocol.
+func NewSession(conn io.ReadWriter) *Session {
+	return &Session{
+		conn:    conn,
+		decoder: ttlv2.NewDecoder(bufio.NewReader(conn)),
+		vars:    make(map[string]string),
+		version: protocolVersion14,
+	}
+}
+
+// SetVersion records which KMIP protocol version subsequent requests on this
+// session should be built for.
+func (s *Session) SetVersion(v protocolVersion) {
+	s.version = v
+}
+
+// SetTimeouts applies a read/write deadline around every Send; zero disables
+// the corresponding deadline. Has no effect if conn isn't a net.Conn.
+func (s *Session) SetTimeouts(readTimeout, writeTimeout time.Duration) {
+	s.readTimeout = readTimeout
+	s.writeTimeout = writeTimeout
+}
+
+// SetDumpWriter makes every subsequent Send append a length-prefixed,
+// timestamped TTLV frame for the request and the response to w (see
+// writeDumpFrame), for later replay via the `replay` subcommand. A nil w
+// disables dumping.
+func (s *Session) SetDumpWriter(w io.Writer) {
+	s.dump = w
+}
+
+// SetTraceWriter makes every subsequent Send print the request and response
+// to w as annotated TTLV (see writeTraceFrame). A nil w disables tracing.
+func (s *Session) SetTraceWriter(w io.Writer) {
+	s.trace = w
+}
+
+// SetRedialer installs a function Reconnect can call to re-establish the
+// connection after it's found broken. Without one, Reconnect always fails.
+func (s *Session) SetRedialer(redial func() (io.ReadWriter, error)) {
+	s.redial = redial
+}
+
+// Reconnect replaces the session's connection by calling the redialer
+// installed via SetRedialer, preserving the session's variables and
+// negotiated protocol version.
+func (s *Session) Reconnect() error {
+	if s.redial == nil {
+		return fmt.Errorf("session has no redialer configured")
+	}
+	conn, err := s.redial()
+	if err != nil {
+		return err
+	}
+	if closer, ok := s.conn.(io.Closer); ok {
+		closer.Close()
+	}
+	s.conn = conn
+	s.decoder = ttlv2.NewDecoder(bufio.NewReader(conn))
+	return nil
+}
+
+// Send writes request to the session's connection and decodes the next TTLV
+// response from it, validating every batch item's result status.
+func (s *Session) Send(request []byte) (ttlv2.TTLV, string, error) {
+	s.recordFrame(dumpDirectionRequest, "-->", ttlv2.TTLV(request))
+
+	if nc, ok := s.conn.(net.Conn); ok && s.writeTimeout > 0 {
+		nc.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	}
+	_, err := s.conn.Write(request)
+	if err != nil {
+		return nil, "Unable to write request", err
+	}
+
+	if nc, ok := s.conn.(net.Conn); ok && s.readTimeout > 0 {
+		nc.SetReadDeadline(time.Now().Add(s.readTimeout))
+	}
+	resp, err := s.decoder.NextTTLV()
+	if err != nil {
+		return nil, "Unable to decode response TTLV", err
+	}
+	s.recordFrame(dumpDirectionResponse, "<--", resp)
+
+	var respMsg kmip.ResponseMessage
+	err = s.decoder.DecodeValue(&respMsg, resp)
+	if err != nil {
+		// still return the raw response even if decoding fails
+		return resp, "", fmt.Errorf("failed to decode response message: %w", err)
+	}
+
+	for i, item := range respMsg.BatchItem {
+		if item.ResultStatus != kmip14.ResultStatusSuccess {
+			return resp, "", fmt.Errorf("KMIP operation in batch item %d failed: %s - %s",
+				i, item.ResultStatus.String(), item.ResultMessage)
+		}
+	}
+
+	hexResponse := fmt.Sprintf("%x", []byte(resp))
+	return resp, hexResponse, nil
+}
+
+// recordFrame writes frame to the session's dump and trace writers, if
+// configured; direction/arrow identify it as a request or a response.
+func (s *Session) recordFrame(direction byte, arrow string, frame ttlv2.TTLV) {
+	if s.dump != nil {
+		if err := writeDumpFrame(s.dump, direction, time.Now(), frame); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to write -dump frame: %v\n", err)
+		}
+	}
+	if s.trace != nil {
+		writeTraceFrame(s.trace, arrow, frame)
+	}
+}
+
+// ReconnectWithBackoff retries Reconnect with exponential backoff, for
+// long-lived callers (the REPL) that want to ride out a dropped connection
+// instead of failing the in-progress command outright.
+func (s *Session) ReconnectWithBackoff(maxAttempts int) error {
+	delay := 500 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = s.Reconnect(); err == nil {
+			return nil
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return fmt.Errorf("reconnect failed after %d attempts: %w", maxAttempts, err)
+}
+
+// isBroken reports whether err looks like a transport failure (as opposed
+// to a KMIP-level error reported by the server) and therefore warrants a
+// reconnect attempt.
+func isBroken(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, isNetErr := err.(net.Error)
+	return isNetErr
+}
+
+// Close releases the underlying connection, if it supports closing.
+func (s *Session) Close() error {
+	if closer, ok := s.dump.(io.Closer); ok {
+		closer.Close()
+	}
+	if closer, ok := s.conn.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SetVar records a named value, e.g. "last.uid", for later substitution via
+// replState.expand.
+func (s *Session) SetVar(name, value string) {
+	s.vars[name] = value
+}
+
+// Var returns a previously recorded value and whether it was set.
+func (s *Session) Var(name string) (string, bool) {
+	v, ok := s.vars[name]
+	return v, ok
+}
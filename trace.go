@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	ttlv2 "github.com/gemalto/kmip-go/ttlv"
+)
+
+// writeTraceFrame pretty-prints frame to w as annotated TTLV - one line per
+// tag with its name, type and length, recursing into structures - similar
+// to `openssl s_client -debug`. direction is a short arrow label such as
+// "-->" (sent) or "<--" (received).
+func writeTraceFrame(w io.Writer, direction string, frame ttlv2.TTLV) {
+	fmt.Fprintf(w, "%s %d bytes\n", direction, len(frame))
+	writeAnnotatedTTLV(w, frame, "  ")
+}
+
+// writeAnnotatedTTLV recursively prints t, indented by indent, as
+// "Tag (Type, len=N): value", descending into Structure values.
+func writeAnnotatedTTLV(w io.Writer, t ttlv2.TTLV, indent string) {
+	fmt.Fprintf(w, "%s%s (%s, len=%d)", indent, t.Tag().String(), t.Type().String(), t.Len())
+
+	if t.Type() == ttlv2.TypeStructure {
+		fmt.Fprintln(w)
+		for _, child := range t.ValueStructure() {
+			writeAnnotatedTTLV(w, child, indent+"  ")
+		}
+		return
+	}
+
+	fmt.Fprintf(w, ": %s\n", traceLeafValue(t))
+}
+
+// traceLeafValue renders a non-structure TTLV's value for -trace, falling
+// back to a hex dump of the raw value bytes for types this client doesn't
+// otherwise need to interpret.
+func traceLeafValue(t ttlv2.TTLV) string {
+	switch t.Type() {
+	case ttlv2.TypeInteger:
+		return fmt.Sprintf("%d", t.ValueInteger())
+	case ttlv2.TypeLongInteger:
+		return fmt.Sprintf("%d", t.ValueLongInteger())
+	case ttlv2.TypeBigInteger:
+		return fmt.Sprintf("%s", t.ValueBigInteger())
+	case ttlv2.TypeEnumeration:
+		return fmt.Sprintf("%d", t.ValueEnumeration())
+	case ttlv2.TypeBoolean:
+		return fmt.Sprintf("%t", t.ValueBoolean())
+	case ttlv2.TypeTextString:
+		return fmt.Sprintf("%q", t.ValueTextString())
+	case ttlv2.TypeByteString:
+		return fmt.Sprintf("%x", t.ValueByteString())
+	case ttlv2.TypeDateTime:
+		return t.ValueDateTime().String()
+	case ttlv2.TypeInterval:
+		return t.ValueInterval().String()
+	default:
+		return fmt.Sprintf("%x", t.ValueRaw())
+	}
+}